@@ -0,0 +1,114 @@
+// Copyright 2016 IBM Corporation
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/amalgam8/controller/middleware"
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeAuthenticator struct {
+	claims *middleware.Claims
+	err    error
+}
+
+func (f *fakeAuthenticator) Authenticate(rawToken string) (*middleware.Claims, error) {
+	return f.claims, f.err
+}
+
+// asHandlerFunc adapts an error-returning handler to rest.HandlerFunc, the
+// same shape reportMetric gives Routes() - the error is already reflected in
+// the response processError wrote, so it's discarded here rather than
+// logged a second time.
+func asHandlerFunc(handler func(w rest.ResponseWriter, req *rest.Request) error) rest.HandlerFunc {
+	return func(w rest.ResponseWriter, req *rest.Request) {
+		_ = handler(w, req)
+	}
+}
+
+// newAuthWrapHandler builds an http.Handler serving GET /test through
+// authWrap alone, bypassing Routes()/reportMetric (which depend on the
+// metrics package, not part of this tree) so authWrap's own behavior can be
+// exercised at the HTTP layer.
+func newAuthWrapHandler(authr middleware.Authenticator, role string, matchTenant bool, called *bool) http.Handler {
+	tenant := &Tenant{}
+	handler := func(w rest.ResponseWriter, req *rest.Request) error {
+		*called = true
+		w.WriteHeader(http.StatusOK)
+		return nil
+	}
+
+	router, err := rest.MakeRouter(rest.Get("/test", asHandlerFunc(tenant.authWrap(authr, handler, role, matchTenant))))
+	if err != nil {
+		panic(err)
+	}
+	api := rest.NewApi()
+	api.SetApp(router)
+	return api.MakeHandler()
+}
+
+func TestAuthWrapNilAuthenticator(t *testing.T) {
+	var called bool
+	h := newAuthWrapHandler(nil, roleTenantRead, false, &called)
+
+	recorded := test.RunRequest(t, h, test.MakeSimpleRequest("GET", "http://localhost/test", nil))
+	recorded.CodeIs(http.StatusUnauthorized)
+	assert.False(t, called, "handler must not run when no authenticator is configured")
+}
+
+func TestAuthWrapAuthenticationError(t *testing.T) {
+	var called bool
+	authr := &fakeAuthenticator{err: &middleware.InvalidTokenError{ErrorMessage: "token_invalid"}}
+	h := newAuthWrapHandler(authr, roleTenantRead, false, &called)
+
+	req := test.MakeSimpleRequest("GET", "http://localhost/test", nil)
+	req.Header.Set("Authorization", "Bearer bad-token")
+	recorded := test.RunRequest(t, h, req)
+	recorded.CodeIs(http.StatusUnauthorized)
+	assert.False(t, called)
+}
+
+// TestAuthWrapInsufficientRole covers the case the request explicitly calls
+// out: a read-only token must not be able to reach a write-scoped route
+// (e.g. PutServiceVersions, DeleteTenant), both of which authWrap guards
+// identically via requiredRole.
+func TestAuthWrapInsufficientRole(t *testing.T) {
+	var called bool
+	authr := &fakeAuthenticator{claims: &middleware.Claims{Roles: []string{"tenant.read"}}}
+	h := newAuthWrapHandler(authr, roleVersionWrite, false, &called)
+
+	req := test.MakeSimpleRequest("GET", "http://localhost/test", nil)
+	req.Header.Set("Authorization", "Bearer read-only-token")
+	recorded := test.RunRequest(t, h, req)
+	recorded.CodeIs(http.StatusForbidden)
+	assert.False(t, called, "handler must not run when the token lacks the required role")
+}
+
+func TestAuthWrapSufficientRolePassesThrough(t *testing.T) {
+	var called bool
+	authr := &fakeAuthenticator{claims: &middleware.Claims{Roles: []string{"versions.write"}}}
+	h := newAuthWrapHandler(authr, roleVersionWrite, false, &called)
+
+	req := test.MakeSimpleRequest("GET", "http://localhost/test", nil)
+	req.Header.Set("Authorization", "Bearer write-token")
+	recorded := test.RunRequest(t, h, req)
+	recorded.CodeIs(http.StatusOK)
+	assert.True(t, called)
+}
@@ -0,0 +1,39 @@
+// Copyright 2016 IBM Corporation
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuoteETag(t *testing.T) {
+	assert.Equal(t, `"42"`, quoteETag("42"))
+}
+
+func TestUnquoteETag(t *testing.T) {
+	cases := []struct {
+		in, want string
+	}{
+		{`"42"`, "42"},
+		{"42", "42"},
+		{`""`, ""},
+		{"", ""},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.want, unquoteETag(c.in), "input %q", c.in)
+	}
+}
@@ -15,10 +15,14 @@
 package api
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"net/http"
+	"time"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/amalgam8/controller/audit"
 	"github.com/amalgam8/controller/manager"
 	"github.com/amalgam8/controller/metrics"
 	"github.com/amalgam8/controller/middleware"
@@ -26,37 +30,257 @@ import (
 	"github.com/ant0ine/go-json-rest/rest"
 )
 
+// claimsEnvKey is where authWrap stashes the authenticated claims in
+// req.Env, for handlers (and auditWrap) that need the caller's identity.
+const claimsEnvKey = "TENANT_CLAIMS"
+
+// auditTenantIDKey is where PostTenant stashes the tenant ID decoded from
+// its request body, for auditWrap/snapshotTenant to read back. It is the
+// one route where GetTenantID(req) cannot supply it; see auditTenantID.
+const auditTenantIDKey = "TENANT_AUDIT_TENANT_ID"
+
 // Tenant handles tenant API calls
 type Tenant struct {
-	reporter metrics.Reporter
-	manager  manager.Manager
+	reporter           metrics.Reporter
+	manager            manager.Manager
+	authenticator      middleware.Authenticator
+	adminAuthenticator middleware.Authenticator
+	auditor            audit.Recorder
+	auditStore         audit.Store
 }
 
 // TenantConfig options
 type TenantConfig struct {
 	Reporter metrics.Reporter
 	Manager  manager.Manager
+
+	// Authenticator verifies tenant-scoped tokens used by PutTenant, GetTenant,
+	// DeleteTenant, and the service-versions routes. Its claims' "tid" must
+	// match the tenant being operated on.
+	Authenticator middleware.Authenticator
+
+	// AdminAuthenticator verifies the admin-scoped tokens used to bootstrap a
+	// new tenant via PostTenant, where there is no existing tenant to scope
+	// the token to.
+	AdminAuthenticator middleware.Authenticator
+
+	// Auditor records tenant and version mutations. If nil, auditing is
+	// disabled.
+	Auditor audit.Recorder
+
+	// AuditStore serves back the events Auditor has recorded, backing
+	// GetTenantAudit. It is typically the same value as Auditor, when the
+	// configured recorder also implements audit.Store. If nil, the audit
+	// endpoint returns a 503.
+	AuditStore audit.Store
 }
 
 // NewTenant creates struct
 func NewTenant(conf TenantConfig) *Tenant {
 	return &Tenant{
-		reporter: conf.Reporter,
-		manager:  conf.Manager,
+		reporter:           conf.Reporter,
+		manager:            conf.Manager,
+		authenticator:      conf.Authenticator,
+		adminAuthenticator: conf.AdminAuthenticator,
+		auditor:            conf.Auditor,
+		auditStore:         conf.AuditStore,
 	}
 }
 
+// Roles enforced on tenant and version routes. A token must carry the role
+// required by the route it is calling.
+const (
+	roleTenantRead   = "tenant.read"
+	roleTenantWrite  = "tenant.write"
+	roleVersionsRead = "versions.read"
+	roleVersionWrite = "versions.write"
+)
+
 // Routes for tenant API calls
 func (t *Tenant) Routes() []*rest.Route {
 	return []*rest.Route{
-		rest.Post("/v1/tenants", reportMetric(t.reporter, t.PostTenant, "tenants_create")),
-		rest.Put("/v1/tenants", reportMetric(t.reporter, t.PutTenant, "tenants_update")),
-		rest.Get("/v1/tenants", reportMetric(t.reporter, t.GetTenant, "tenants_read")),
-		rest.Delete("/v1/tenants", reportMetric(t.reporter, t.DeleteTenant, "tenants_delete")),
-		rest.Put("/v1/versions/#service", reportMetric(t.reporter, t.PutServiceVersions, "versions_update")),
-		rest.Get("/v1/versions/#service", reportMetric(t.reporter, t.GetServiceVersions, "versions_read")),
-		rest.Delete("/v1/versions/#service", reportMetric(t.reporter, t.DeleteServiceVersions, "versions_update")),
+		rest.Post("/v1/tenants", reportMetric(t.reporter, t.authWrap(t.adminAuthenticator, t.auditWrap(t.PostTenant, "tenant.create", t.snapshotTenant), roleTenantWrite, false), "tenants_create")),
+		rest.Put("/v1/tenants", reportMetric(t.reporter, t.authWrap(t.authenticator, t.auditWrap(t.PutTenant, "tenant.update", t.snapshotTenant), roleTenantWrite, true), "tenants_update")),
+		rest.Get("/v1/tenants", reportMetric(t.reporter, t.authWrap(t.authenticator, t.GetTenant, roleTenantRead, true), "tenants_read")),
+		rest.Delete("/v1/tenants", reportMetric(t.reporter, t.authWrap(t.authenticator, t.auditWrap(t.DeleteTenant, "tenant.delete", t.snapshotTenant), roleTenantWrite, true), "tenants_delete")),
+		rest.Put("/v1/versions/#service", reportMetric(t.reporter, t.authWrap(t.authenticator, t.auditWrap(t.PutServiceVersions, "versions.update", t.snapshotVersion), roleVersionWrite, true), "versions_update")),
+		rest.Get("/v1/versions/#service", reportMetric(t.reporter, t.authWrap(t.authenticator, t.GetServiceVersions, roleVersionsRead, true), "versions_read")),
+		rest.Delete("/v1/versions/#service", reportMetric(t.reporter, t.authWrap(t.authenticator, t.auditWrap(t.DeleteServiceVersions, "versions.delete", t.snapshotVersion), roleVersionWrite, true), "versions_update")),
+		rest.Get("/v1/tenants/audit", reportMetric(t.reporter, t.authWrap(t.authenticator, t.GetTenantAudit, roleTenantRead, true), "tenants_audit_read")),
+	}
+}
+
+// authWrap authenticates the bearer token on req with authr, checks that the
+// token carries requiredRole, and, when matchTenant is set, that the token's
+// "tid" claim matches the tenant being operated on. matchTenant is false only
+// for PostTenant, where tenant bootstrap has no existing tenant to scope an
+// admin token to. Authentication and authorization failures are reported
+// through processError as 401/403 responses and short-circuit handler. authr
+// being nil (a Tenant constructed without an Authenticator/AdminAuthenticator)
+// fails closed with a 401 rather than panicking on the nil interface call.
+func (t *Tenant) authWrap(authr middleware.Authenticator, handler func(w rest.ResponseWriter, req *rest.Request) error, requiredRole string, matchTenant bool) func(w rest.ResponseWriter, req *rest.Request) error {
+	return func(w rest.ResponseWriter, req *rest.Request) error {
+		if authr == nil {
+			err := &middleware.InvalidTokenError{ErrorMessage: "authenticator_not_configured"}
+			processError(w, req, err)
+			return err
+		}
+
+		rawToken := middleware.ExtractBearerToken(req.Request)
+		claims, err := authr.Authenticate(rawToken)
+		if err != nil {
+			processError(w, req, err)
+			return err
+		}
+
+		if !claims.HasRole(requiredRole) {
+			err := &middleware.ForbiddenError{ErrorMessage: "insufficient_scope"}
+			processError(w, req, err)
+			return err
+		}
+
+		if matchTenant {
+			if tenantID := GetTenantID(req); claims.TenantID != tenantID {
+				err := &middleware.ForbiddenError{ErrorMessage: "tenant_mismatch"}
+				processError(w, req, err)
+				return err
+			}
+		}
+
+		req.Env[claimsEnvKey] = claims
+		return handler(w, req)
+	}
+}
+
+// auditWrap records an audit.Event for a mutating handler, once t.auditor is
+// configured. snapshot reads the current state of the resource the route
+// operates on (a TenantInfo or a Version); auditWrap calls it once before
+// handler runs and once after, so the event carries a before/after diff
+// without handler itself needing to know about auditing. A snapshot error
+// (e.g. "not found" before a create, or after a delete) simply yields a nil
+// Before/After rather than failing the request.
+func (t *Tenant) auditWrap(handler func(w rest.ResponseWriter, req *rest.Request) error, action string, snapshot func(req *rest.Request) (interface{}, error)) func(w rest.ResponseWriter, req *rest.Request) error {
+	return func(w rest.ResponseWriter, req *rest.Request) error {
+		if t.auditor == nil {
+			return handler(w, req)
+		}
+
+		before, _ := snapshot(req)
+		handlerErr := handler(w, req)
+		after, _ := snapshot(req)
+
+		event := audit.Event{
+			Timestamp: time.Now(),
+			TenantID:  auditTenantID(req),
+			Action:    action,
+			RequestID: req.Header.Get(middleware.RequestIDHeader),
+			Outcome:   audit.OutcomeSuccess,
+			Before:    toJSON(before),
+			After:     toJSON(after),
+		}
+		if claims, ok := req.Env[claimsEnvKey].(*middleware.Claims); ok {
+			event.Actor = claims.Subject
+		}
+		if handlerErr != nil {
+			event.Outcome = audit.OutcomeError
+			event.Error = handlerErr.Error()
+		}
+
+		t.auditor.Record(context.Background(), event)
+		return handlerErr
+	}
+}
+
+// snapshotTenant reads the current TenantInfo for the tenant req targets,
+// for use as an auditWrap snapshot function.
+func (t *Tenant) snapshotTenant(req *rest.Request) (interface{}, error) {
+	tenantID := auditTenantID(req)
+	entry, err := t.manager.Get(tenantID)
+	if err != nil {
+		return nil, err
+	}
+	return resources.TenantInfo{
+		ID:                tenantID,
+		Credentials:       entry.ProxyConfig.Credentials,
+		LoadBalance:       entry.ProxyConfig.LoadBalance,
+		Port:              entry.ProxyConfig.Port,
+		ReqTrackingHeader: entry.ProxyConfig.ReqTrackingHeader,
+		Filters:           entry.ProxyConfig.Filters,
+		Revision:          entry.Revision,
+	}, nil
+}
+
+// auditTenantID returns the tenant ID an audit.Event for req should be
+// recorded against. This is GetTenantID(req) for every route except
+// PostTenant, whose tenant doesn't exist yet when the route is matched: the
+// real ID only becomes known once the request body is decoded, so PostTenant
+// stashes it in req.Env under auditTenantIDKey for auditWrap/snapshotTenant
+// to pick up here.
+func auditTenantID(req *rest.Request) string {
+	if id, ok := req.Env[auditTenantIDKey].(string); ok {
+		return id
+	}
+	return GetTenantID(req)
+}
+
+// snapshotVersion reads the current Version for the service req targets, for
+// use as an auditWrap snapshot function.
+func (t *Tenant) snapshotVersion(req *rest.Request) (interface{}, error) {
+	version, err := t.manager.GetVersion(GetTenantID(req), req.PathParam("service"))
+	if err != nil {
+		return nil, err
+	}
+	return version, nil
+}
+
+// toJSON marshals v for embedding in an audit.Event, returning nil if v is
+// nil or cannot be marshaled.
+func toJSON(v interface{}) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		logrus.WithField("err", err).Warn("Could not marshal audit snapshot")
+		return nil
+	}
+	return b
+}
+
+// GetTenantAudit streams audit records for a tenant recorded at or after the
+// "since" query parameter (RFC3339; defaults to the zero time, i.e. all
+// records) so operators can reconstruct who changed routing rules and when.
+func (t *Tenant) GetTenantAudit(w rest.ResponseWriter, req *rest.Request) error {
+	tenantID := GetTenantID(req)
+	if tenantID == "" {
+		RestError(w, req, http.StatusBadRequest, "error_invalid_input")
+		return errors.New("special error")
+	}
+
+	if t.auditStore == nil {
+		RestError(w, req, http.StatusServiceUnavailable, "audit_not_configured")
+		return errors.New("audit store not configured")
 	}
+
+	since := time.Time{}
+	if raw := req.URL.Query().Get("since"); raw != "" {
+		parsed, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			RestError(w, req, http.StatusBadRequest, "error_invalid_input")
+			return err
+		}
+		since = parsed
+	}
+
+	events, err := t.auditStore.Query(context.Background(), tenantID, since)
+	if err != nil {
+		RestError(w, req, http.StatusServiceUnavailable, "audit_query_failed")
+		return err
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.WriteJson(&events)
+	return nil
 }
 
 // PostTenant initializes a tenant in the Controller
@@ -75,6 +299,12 @@ func (t *Tenant) PostTenant(w rest.ResponseWriter, req *rest.Request) error {
 		return errors.New("special error")
 	}
 
+	// PostTenant is the one route auditTenantID can't infer from the request
+	// path: stash the real tenant ID from the decoded body so auditWrap and
+	// snapshotTenant record the "after" state against the tenant that was
+	// actually created (or attempted), not GetTenantID(req).
+	req.Env[auditTenantIDKey] = tenantInfo.ID
+
 	if err = t.manager.Create(tenantInfo.ID, tenantInfo); err != nil {
 		processError(w, req, err)
 		return err
@@ -84,7 +314,9 @@ func (t *Tenant) PostTenant(w rest.ResponseWriter, req *rest.Request) error {
 	return nil
 }
 
-// PutTenant updates credentials and/or metadata for a tenant
+// PutTenant updates credentials and/or metadata for a tenant. A conditional
+// request (If-Match or If-None-Match: *) is honored against the tenant's
+// revision; see compareAndSetTenant.
 func (t *Tenant) PutTenant(w rest.ResponseWriter, req *rest.Request) error {
 	var err error
 
@@ -101,7 +333,7 @@ func (t *Tenant) PutTenant(w rest.ResponseWriter, req *rest.Request) error {
 		return err
 	}
 
-	if err = t.manager.Set(tenantID, tenantInfo); err != nil {
+	if err = t.compareAndSetTenant(tenantID, tenantInfo, req); err != nil {
 		processError(w, req, err)
 		return err
 	}
@@ -110,7 +342,23 @@ func (t *Tenant) PutTenant(w rest.ResponseWriter, req *rest.Request) error {
 	return nil
 }
 
-// GetTenant returns credentials and metadata for a tenant
+// compareAndSetTenant updates tenantID's config, honoring an If-Match or
+// If-None-Match: * precondition from req if present, and falling back to an
+// unconditional update otherwise. A precondition mismatch surfaces as
+// *manager.ConcurrencyError, which processError maps to 412 or 409.
+func (t *Tenant) compareAndSetTenant(tenantID string, tenantInfo resources.TenantInfo, req *rest.Request) error {
+	if ifNoneMatch := req.Header.Get("If-None-Match"); ifNoneMatch == "*" {
+		return t.manager.CompareAndSet(tenantID, tenantInfo, "")
+	}
+	if ifMatch := req.Header.Get("If-Match"); ifMatch != "" {
+		return t.manager.CompareAndSet(tenantID, tenantInfo, unquoteETag(ifMatch))
+	}
+	return t.manager.Set(tenantID, tenantInfo)
+}
+
+// GetTenant returns credentials and metadata for a tenant, with its current
+// revision reflected in the ETag response header for use in a later
+// conditional PutTenant/DeleteTenant.
 func (t *Tenant) GetTenant(w rest.ResponseWriter, req *rest.Request) error {
 	// validate auth header
 	// if this tenant has orphans, CSB will know that the token is invalid
@@ -134,14 +382,18 @@ func (t *Tenant) GetTenant(w rest.ResponseWriter, req *rest.Request) error {
 		Port:              entry.ProxyConfig.Port,
 		ReqTrackingHeader: entry.ProxyConfig.ReqTrackingHeader,
 		Filters:           entry.ProxyConfig.Filters,
+		Revision:          entry.Revision,
 	}
 
+	w.Header().Set("ETag", quoteETag(entry.Revision))
 	w.WriteHeader(http.StatusOK)
 	w.WriteJson(&tenantInfo)
 	return nil
 }
 
-// GetServiceVersions returns versioning info for a service of a tenant
+// GetServiceVersions returns versioning info for a service of a tenant, with
+// its current revision reflected in the ETag response header for use in a
+// later conditional PutServiceVersions/DeleteServiceVersions.
 func (t *Tenant) GetServiceVersions(w rest.ResponseWriter, req *rest.Request) error {
 	reqID := req.Header.Get(middleware.RequestIDHeader)
 
@@ -158,6 +410,8 @@ func (t *Tenant) GetServiceVersions(w rest.ResponseWriter, req *rest.Request) er
 		return err
 	}
 
+	w.Header().Set("ETag", quoteETag(respJSON.Revision))
+
 	err = w.WriteJson(respJSON)
 	if err != nil {
 		logrus.WithFields(logrus.Fields{
@@ -171,7 +425,9 @@ func (t *Tenant) GetServiceVersions(w rest.ResponseWriter, req *rest.Request) er
 	return nil
 }
 
-// PutServiceVersions adds versioning info for a service of a tenant
+// PutServiceVersions adds versioning info for a service of a tenant. A
+// conditional request (If-Match or If-None-Match: *) is honored against the
+// version's revision; see compareAndSetVersion.
 func (t *Tenant) PutServiceVersions(w rest.ResponseWriter, req *rest.Request) error {
 	reqID := req.Header.Get(middleware.RequestIDHeader)
 
@@ -195,7 +451,7 @@ func (t *Tenant) PutServiceVersions(w rest.ResponseWriter, req *rest.Request) er
 	}
 	newVersion.Service = service
 
-	if err := t.manager.SetVersion(tenantID, newVersion); err != nil {
+	if err := t.compareAndSetVersion(tenantID, newVersion, req); err != nil {
 		processError(w, req, err)
 		return err
 	}
@@ -204,7 +460,21 @@ func (t *Tenant) PutServiceVersions(w rest.ResponseWriter, req *rest.Request) er
 	return nil
 }
 
-// DeleteServiceVersions deletes versioning info for a service of a tenant
+// compareAndSetVersion updates the version for tenantID/newVersion.Service,
+// honoring an If-Match or If-None-Match: * precondition from req if present,
+// and falling back to an unconditional update otherwise.
+func (t *Tenant) compareAndSetVersion(tenantID string, newVersion resources.Version, req *rest.Request) error {
+	if ifNoneMatch := req.Header.Get("If-None-Match"); ifNoneMatch == "*" {
+		return t.manager.CompareAndSetVersion(tenantID, newVersion, "")
+	}
+	if ifMatch := req.Header.Get("If-Match"); ifMatch != "" {
+		return t.manager.CompareAndSetVersion(tenantID, newVersion, unquoteETag(ifMatch))
+	}
+	return t.manager.SetVersion(tenantID, newVersion)
+}
+
+// DeleteServiceVersions deletes versioning info for a service of a tenant. An
+// If-Match precondition is honored against the version's revision.
 func (t *Tenant) DeleteServiceVersions(w rest.ResponseWriter, req *rest.Request) error {
 	//reqID := req.Header.Get(middleware.RequestIDHeader)
 
@@ -215,18 +485,23 @@ func (t *Tenant) DeleteServiceVersions(w rest.ResponseWriter, req *rest.Request)
 	}
 	service := req.PathParam("service")
 
-	if err := t.manager.DeleteVersion(tenantID, service); err != nil {
-		if err != nil {
-			processError(w, req, err)
-			return err
-		}
+	var err error
+	if ifMatch := req.Header.Get("If-Match"); ifMatch != "" {
+		err = t.manager.CompareAndDeleteVersion(tenantID, service, unquoteETag(ifMatch))
+	} else {
+		err = t.manager.DeleteVersion(tenantID, service)
+	}
+	if err != nil {
+		processError(w, req, err)
+		return err
 	}
 
 	w.WriteHeader(http.StatusOK)
 	return nil
 }
 
-// DeleteTenant removes tenant from Controller
+// DeleteTenant removes tenant from Controller. An If-Match precondition is
+// honored against the tenant's revision.
 func (t *Tenant) DeleteTenant(w rest.ResponseWriter, req *rest.Request) error {
 	var err error
 
@@ -237,7 +512,12 @@ func (t *Tenant) DeleteTenant(w rest.ResponseWriter, req *rest.Request) error {
 	}
 
 	// Delete from rules
-	if err = t.manager.Delete(tenantID); err != nil {
+	if ifMatch := req.Header.Get("If-Match"); ifMatch != "" {
+		err = t.manager.CompareAndDelete(tenantID, unquoteETag(ifMatch))
+	} else {
+		err = t.manager.Delete(tenantID)
+	}
+	if err != nil {
 		processError(w, req, err)
 		return err
 	}
@@ -246,6 +526,20 @@ func (t *Tenant) DeleteTenant(w rest.ResponseWriter, req *rest.Request) error {
 	return nil
 }
 
+// quoteETag formats a manager revision as a strong ETag value.
+func quoteETag(revision string) string {
+	return `"` + revision + `"`
+}
+
+// unquoteETag strips the quotes go-json-rest clients send around an
+// If-Match/If-None-Match value, tolerating a bare (unquoted) revision too.
+func unquoteETag(etag string) string {
+	if len(etag) >= 2 && etag[0] == '"' && etag[len(etag)-1] == '"' {
+		return etag[1 : len(etag)-1]
+	}
+	return etag
+}
+
 func processError(w rest.ResponseWriter, req *rest.Request, err error) {
 	if err != nil {
 		tenantID := GetTenantID(req)
@@ -256,7 +550,21 @@ func processError(w rest.ResponseWriter, req *rest.Request, err error) {
 			"tenant_id":  tenantID,
 			"request_id": requestID,
 		})
-		if e, ok := err.(*manager.InvalidRuleError); ok {
+		if e, ok := err.(*middleware.InvalidTokenError); ok {
+			log.Warn("Unauthorized")
+			RestError(w, req, http.StatusUnauthorized, e.ErrorMessage)
+		} else if e, ok := err.(*middleware.ForbiddenError); ok {
+			log.Warn("Forbidden")
+			RestError(w, req, http.StatusForbidden, e.ErrorMessage)
+		} else if e, ok := err.(*manager.ConcurrencyError); ok {
+			if e.Exists {
+				log.Warn("Resource already exists")
+				RestError(w, req, http.StatusConflict, e.ErrorMessage)
+			} else {
+				log.Warn("Precondition failed")
+				RestError(w, req, http.StatusPreconditionFailed, e.ErrorMessage)
+			}
+		} else if e, ok := err.(*manager.InvalidRuleError); ok {
 			log.Error("Bad request")
 			RestError(w, req, http.StatusBadRequest, e.ErrorMessage)
 		} else if e, ok := err.(*manager.DBError); ok {
@@ -0,0 +1,85 @@
+// Copyright 2016 IBM Corporation
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+// Package audit records who changed a tenant's routing configuration, when,
+// and what changed, so operators can reconstruct the history of a tenant's
+// rules after the fact.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// Outcome values recorded on an Event.
+const (
+	OutcomeSuccess = "success"
+	OutcomeError   = "error"
+)
+
+// Event is a single audit record for a tenant or version mutation.
+type Event struct {
+	// ID identifies this event, independent of storage backend. Neither the
+	// Tenant API's auditWrap nor the recorders in this package set it, so it
+	// is empty unless whoever builds the Event fills it in.
+	ID string `json:"id"`
+
+	// Timestamp is when the mutation was applied.
+	Timestamp time.Time `json:"timestamp"`
+
+	// TenantID is the tenant the mutation was performed against.
+	TenantID string `json:"tenant_id"`
+
+	// Actor is the "sub" claim of the token that authorized the mutation.
+	Actor string `json:"actor"`
+
+	// Action names the operation, e.g. "tenant.create", "tenant.update",
+	// "tenant.delete", "versions.update", "versions.delete".
+	Action string `json:"action"`
+
+	// RequestID correlates this event with the request's X-Request-ID.
+	RequestID string `json:"request_id"`
+
+	// Outcome is OutcomeSuccess or OutcomeError.
+	Outcome string `json:"outcome"`
+
+	// Before and After are JSON snapshots of the affected resource
+	// (TenantInfo or Version) immediately before and after the mutation.
+	// Each is omitted when no resource exists at that moment: Before for a
+	// create, After for a delete. A failed mutation leaves the resource as it
+	// was, so its After carries that unchanged state.
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+
+	// Error is the mutation's error message, set only when Outcome is
+	// OutcomeError.
+	Error string `json:"error,omitempty"`
+}
+
+// Recorder accepts audit events. Implementations must not block the caller:
+// a stalled or unreachable sink (a full Kafka buffer, a wedged disk) must be
+// absorbed internally, with the event dropped and logged rather than the
+// caller stalling on it.
+type Recorder interface {
+	Record(ctx context.Context, event Event)
+}
+
+// Store is implemented by Recorders that can also serve back the events they
+// have recorded, for the tenant audit-log API.
+type Store interface {
+	// Query returns events for tenantID recorded at or after since, oldest
+	// first.
+	Query(ctx context.Context, tenantID string, since time.Time) ([]Event, error)
+}
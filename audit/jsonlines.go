@@ -0,0 +1,271 @@
+// Copyright 2016 IBM Corporation
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// JSONLinesConfig configures a JSONLinesRecorder.
+type JSONLinesConfig struct {
+	// Path is the sink file. If empty, events are written to stdout and
+	// Query always returns an error, since stdout cannot be read back.
+	Path string
+
+	// BufferSize bounds how many events may be queued for the writer
+	// goroutine before Record starts dropping events. Defaults to 1024.
+	BufferSize int
+
+	// MaxSizeBytes rotates Path once it grows past this size. Zero disables
+	// rotation.
+	MaxSizeBytes int64
+
+	// MaxBackups caps how many rotated files (Path.<unix-nanoseconds>) are
+	// kept; older ones are removed. Zero means unlimited.
+	MaxBackups int
+
+	// MaxAge removes rotated backups older than this once surpassed. Zero
+	// disables age-based pruning.
+	MaxAge time.Duration
+}
+
+// JSONLinesRecorder writes audit events as newline-delimited JSON to a file
+// or to stdout. A bounded internal buffer and a single writer goroutine
+// decouple Record from disk I/O, so a slow or stalled disk never blocks the
+// API handler that triggered the event; once the buffer fills, new events
+// are dropped and logged rather than queued indefinitely.
+type JSONLinesRecorder struct {
+	conf   JSONLinesConfig
+	events chan Event
+	done   chan struct{}
+
+	mutex sync.Mutex
+	file  *os.File
+	size  int64
+}
+
+// NewJSONLinesRecorder creates a JSONLinesRecorder and starts its background
+// writer goroutine. Close should be called on shutdown to stop it; events
+// still queued when Close is called are not written.
+func NewJSONLinesRecorder(conf JSONLinesConfig) (*JSONLinesRecorder, error) {
+	if conf.BufferSize <= 0 {
+		conf.BufferSize = 1024
+	}
+
+	r := &JSONLinesRecorder{
+		conf:   conf,
+		events: make(chan Event, conf.BufferSize),
+		done:   make(chan struct{}),
+	}
+
+	if conf.Path != "" {
+		if err := r.openFile(); err != nil {
+			return nil, err
+		}
+	}
+
+	go r.run()
+	return r, nil
+}
+
+// Record enqueues event for the writer goroutine. If the buffer is full, the
+// event is dropped and a warning is logged; Record never blocks.
+func (r *JSONLinesRecorder) Record(ctx context.Context, event Event) {
+	select {
+	case r.events <- event:
+	default:
+		logrus.WithFields(logrus.Fields{
+			"tenant_id": event.TenantID,
+			"action":    event.Action,
+		}).Warn("Audit buffer full, dropping event")
+	}
+}
+
+// Close stops the writer goroutine and closes the underlying file, if any.
+// Events still in the buffer are discarded, not flushed.
+func (r *JSONLinesRecorder) Close() error {
+	close(r.done)
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.file != nil {
+		return r.file.Close()
+	}
+	return nil
+}
+
+func (r *JSONLinesRecorder) run() {
+	for {
+		select {
+		case event := <-r.events:
+			r.write(event)
+		case <-r.done:
+			return
+		}
+	}
+}
+
+func (r *JSONLinesRecorder) write(event Event) {
+	line, err := json.Marshal(event)
+	if err != nil {
+		logrus.WithField("err", err).Error("Could not marshal audit event")
+		return
+	}
+	line = append(line, '\n')
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	out := io.Writer(os.Stdout)
+	if r.file != nil {
+		if r.conf.MaxSizeBytes > 0 && r.size+int64(len(line)) > r.conf.MaxSizeBytes {
+			if err := r.rotateLocked(); err != nil {
+				logrus.WithField("err", err).Error("Could not rotate audit log")
+			}
+		}
+		out = r.file
+	}
+
+	n, err := out.Write(line)
+	if err != nil {
+		logrus.WithField("err", err).Error("Could not write audit event")
+		return
+	}
+	r.size += int64(n)
+}
+
+func (r *JSONLinesRecorder) openFile() error {
+	f, err := os.OpenFile(r.conf.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("audit: opening %s: %v", r.conf.Path, err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("audit: statting %s: %v", r.conf.Path, err)
+	}
+	r.file = f
+	r.size = info.Size()
+	return nil
+}
+
+// rotateLocked renames the current file aside and opens a fresh one. The
+// caller must hold r.mutex.
+func (r *JSONLinesRecorder) rotateLocked() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	rotated := fmt.Sprintf("%s.%d", r.conf.Path, time.Now().UnixNano())
+	if err := os.Rename(r.conf.Path, rotated); err != nil {
+		return err
+	}
+
+	if err := r.openFile(); err != nil {
+		return err
+	}
+
+	go r.pruneBackups()
+	return nil
+}
+
+func (r *JSONLinesRecorder) pruneBackups() {
+	matches, err := filepath.Glob(r.conf.Path + ".*")
+	if err != nil {
+		logrus.WithField("err", err).Warn("Could not list audit log backups")
+		return
+	}
+	sort.Strings(matches)
+
+	now := time.Now()
+	kept := make([]string, 0, len(matches))
+	for _, m := range matches {
+		if r.conf.MaxAge > 0 {
+			if info, err := os.Stat(m); err == nil && now.Sub(info.ModTime()) > r.conf.MaxAge {
+				os.Remove(m)
+				continue
+			}
+		}
+		kept = append(kept, m)
+	}
+
+	if r.conf.MaxBackups > 0 && len(kept) > r.conf.MaxBackups {
+		for _, m := range kept[:len(kept)-r.conf.MaxBackups] {
+			os.Remove(m)
+		}
+	}
+}
+
+// Query implements Store by scanning Path and any rotated backups for
+// matching events. It is a best-effort, full-scan implementation intended
+// for operator troubleshooting rather than high-volume querying.
+func (r *JSONLinesRecorder) Query(ctx context.Context, tenantID string, since time.Time) ([]Event, error) {
+	if r.conf.Path == "" {
+		return nil, fmt.Errorf("audit: stdout sink does not support querying")
+	}
+
+	files, err := filepath.Glob(r.conf.Path + "*")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	var results []Event
+	for _, path := range files {
+		events, err := r.queryFile(path, tenantID, since)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{"err": err, "path": path}).Warn("Could not read audit log file")
+			continue
+		}
+		results = append(results, events...)
+	}
+
+	sort.Slice(results, func(i, j int) bool { return results[i].Timestamp.Before(results[j].Timestamp) })
+	return results, nil
+}
+
+func (r *JSONLinesRecorder) queryFile(path, tenantID string, since time.Time) ([]Event, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var events []Event
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			continue
+		}
+		if event.TenantID != tenantID {
+			continue
+		}
+		if event.Timestamp.Before(since) {
+			continue
+		}
+		events = append(events, event)
+	}
+	return events, scanner.Err()
+}
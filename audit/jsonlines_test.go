@@ -0,0 +1,84 @@
+// Copyright 2016 IBM Corporation
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package audit
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONLinesRecorderRecordAndQuery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "audit.log")
+	r, err := NewJSONLinesRecorder(JSONLinesConfig{Path: path})
+	assert.NoError(t, err)
+	defer r.Close()
+
+	older := Event{TenantID: "tenant1", Action: "tenant.update", Timestamp: time.Now().Add(-time.Hour)}
+	newer := Event{TenantID: "tenant1", Action: "tenant.delete", Timestamp: time.Now()}
+	other := Event{TenantID: "tenant2", Action: "tenant.update", Timestamp: time.Now()}
+
+	r.Record(context.Background(), older)
+	r.Record(context.Background(), newer)
+	r.Record(context.Background(), other)
+
+	assert.Eventually(t, func() bool {
+		events, err := r.Query(context.Background(), "tenant1", time.Time{})
+		return err == nil && len(events) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	events, err := r.Query(context.Background(), "tenant1", time.Now().Add(-time.Minute))
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+	assert.Equal(t, "tenant.delete", events[0].Action)
+}
+
+func TestJSONLinesRecorderBufferFullDropsInsteadOfBlocking(t *testing.T) {
+	r, err := NewJSONLinesRecorder(JSONLinesConfig{BufferSize: 1})
+	assert.NoError(t, err)
+	defer r.Close()
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			r.Record(context.Background(), Event{TenantID: "tenant1"})
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Record blocked instead of dropping events once the buffer filled")
+	}
+}
+
+func TestJSONLinesRecorderStdoutSinkDoesNotSupportQuery(t *testing.T) {
+	r, err := NewJSONLinesRecorder(JSONLinesConfig{})
+	assert.NoError(t, err)
+	defer r.Close()
+
+	_, err = r.Query(context.Background(), "tenant1", time.Time{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,75 @@
+// Copyright 2016 IBM Corporation
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package audit
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/Shopify/sarama"
+	"github.com/Sirupsen/logrus"
+)
+
+// KafkaRecorder publishes audit events as JSON to a Kafka topic, reusing the
+// module's existing Kafka producer. It never blocks the caller: events are
+// handed to the producer's input channel only if there is room, and are
+// otherwise dropped and logged.
+type KafkaRecorder struct {
+	producer sarama.AsyncProducer
+	topic    string
+}
+
+// NewKafkaRecorder wraps producer, publishing events to topic. It starts a
+// background goroutine that drains producer's Errors channel so a persistent
+// broker failure surfaces in the logs instead of as a goroutine leak.
+func NewKafkaRecorder(producer sarama.AsyncProducer, topic string) *KafkaRecorder {
+	r := &KafkaRecorder{producer: producer, topic: topic}
+	go r.logErrors()
+	return r
+}
+
+// Record publishes event to the configured topic, keyed by tenant ID so a
+// given tenant's events stay in partition order. If the producer's input
+// channel is full (a stalled or unreachable broker), the event is dropped
+// and logged rather than blocking the caller.
+func (r *KafkaRecorder) Record(ctx context.Context, event Event) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		logrus.WithField("err", err).Error("Could not marshal audit event for Kafka")
+		return
+	}
+
+	msg := &sarama.ProducerMessage{
+		Topic: r.topic,
+		Key:   sarama.StringEncoder(event.TenantID),
+		Value: sarama.ByteEncoder(payload),
+	}
+
+	select {
+	case r.producer.Input() <- msg:
+	default:
+		logrus.WithFields(logrus.Fields{
+			"tenant_id": event.TenantID,
+			"action":    event.Action,
+			"topic":     r.topic,
+		}).Warn("Audit Kafka producer backlogged, dropping event")
+	}
+}
+
+func (r *KafkaRecorder) logErrors() {
+	for err := range r.producer.Errors() {
+		logrus.WithField("err", err).Error("Could not publish audit event to Kafka")
+	}
+}
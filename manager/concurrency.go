@@ -0,0 +1,33 @@
+// Copyright 2016 IBM Corporation
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package manager
+
+// ConcurrencyError is returned by CompareAndSet/CompareAndDelete-style
+// methods when the caller's expected revision does not match the resource's
+// current revision, or (for create-like semantics) when the resource
+// already exists. Exists is set in the latter case so callers can tell a
+// stale-write 412 apart from an already-exists 409.
+type ConcurrencyError struct {
+	ErrorMessage string
+
+	// Exists is true when the conflict is that the resource already exists
+	// (an If-None-Match: * precondition failure), and false when it is a
+	// stale revision (an If-Match precondition failure).
+	Exists bool
+}
+
+func (e *ConcurrencyError) Error() string {
+	return e.ErrorMessage
+}
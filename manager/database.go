@@ -0,0 +1,30 @@
+// Copyright 2016 IBM Corporation
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package manager
+
+// Database is the key/value persistence abstraction Manager is built on, so
+// its CompareAndSet/CompareAndDelete logic runs unchanged whether the
+// backing store is MemoryDatabase (tests, single-replica deployments) or a
+// real persistent implementation such as FileDatabase.
+type Database interface {
+	// Get returns the value stored at key, and false if key is unset.
+	Get(key string) ([]byte, bool, error)
+
+	// Put stores value at key, creating or overwriting it.
+	Put(key string, value []byte) error
+
+	// Delete removes key. It is not an error for key to already be unset.
+	Delete(key string) error
+}
@@ -0,0 +1,47 @@
+// Copyright 2016 IBM Corporation
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package manager
+
+// InvalidRuleError indicates a request failed application-level validation
+// (e.g. a malformed routing rule).
+type InvalidRuleError struct {
+	ErrorMessage string
+}
+
+func (e *InvalidRuleError) Error() string { return e.ErrorMessage }
+
+// RuleNotFoundError indicates the requested tenant or version configuration
+// does not exist.
+type RuleNotFoundError struct {
+	ErrorMessage string
+}
+
+func (e *RuleNotFoundError) Error() string { return e.ErrorMessage }
+
+// ServiceUnavailableError indicates the backing Database is temporarily
+// unreachable.
+type ServiceUnavailableError struct {
+	ErrorMessage string
+}
+
+func (e *ServiceUnavailableError) Error() string { return e.ErrorMessage }
+
+// DBError wraps a lower-level Database error.
+type DBError struct {
+	ErrorMessage string
+	Err          error
+}
+
+func (e *DBError) Error() string { return e.ErrorMessage }
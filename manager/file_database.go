@@ -0,0 +1,81 @@
+// Copyright 2016 IBM Corporation
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package manager
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// FileDatabase is a Database backed by one file per key under BaseDir. It
+// stands in for a real persistent store (etcd, Couchbase, ...) in
+// deployments and environments where running one isn't practical, giving
+// Manager's CompareAndSet/CompareAndDelete logic a genuine disk-backed
+// Database to run against alongside MemoryDatabase.
+type FileDatabase struct {
+	baseDir string
+	mutex   sync.Mutex
+}
+
+// NewFileDatabase creates a FileDatabase rooted at baseDir, creating it if
+// necessary.
+func NewFileDatabase(baseDir string) (*FileDatabase, error) {
+	if err := os.MkdirAll(baseDir, 0755); err != nil {
+		return nil, fmt.Errorf("manager: creating %s: %v", baseDir, err)
+	}
+	return &FileDatabase{baseDir: baseDir}, nil
+}
+
+func (f *FileDatabase) path(key string) string {
+	return filepath.Join(f.baseDir, url.QueryEscape(key))
+}
+
+// Get implements Database.
+func (f *FileDatabase) Get(key string) ([]byte, bool, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	value, err := ioutil.ReadFile(f.path(key))
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// Put implements Database.
+func (f *FileDatabase) Put(key string, value []byte) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return ioutil.WriteFile(f.path(key), value, 0644)
+}
+
+// Delete implements Database.
+func (f *FileDatabase) Delete(key string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	err := os.Remove(f.path(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
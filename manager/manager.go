@@ -0,0 +1,311 @@
+// Copyright 2016 IBM Corporation
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+// Package manager maintains tenant and per-service version configuration on
+// behalf of the Tenant API.
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/amalgam8/controller/resources"
+)
+
+// Manager exposes tenant and per-service version configuration, backed by a
+// Database implementation chosen at construction time.
+type Manager interface {
+	// Create stores tenantInfo for a new tenant id. It fails with a
+	// *ConcurrencyError (Exists: true) if the tenant already exists.
+	Create(id string, tenantInfo resources.TenantInfo) error
+
+	// Set unconditionally overwrites id's tenant config.
+	Set(id string, tenantInfo resources.TenantInfo) error
+
+	// Get returns id's current tenant config.
+	Get(id string) (*Entry, error)
+
+	// Delete unconditionally removes id's tenant config.
+	Delete(id string) error
+
+	// GetVersion returns the current version config for id/service.
+	GetVersion(id, service string) (*resources.Version, error)
+
+	// SetVersion unconditionally overwrites the version config for
+	// id/version.Service.
+	SetVersion(id string, version resources.Version) error
+
+	// DeleteVersion unconditionally removes the version config for
+	// id/service.
+	DeleteVersion(id, service string) error
+
+	// CompareAndSet updates id's tenant config only if its current revision
+	// equals expectedRevision, or, when expectedRevision is "", only if the
+	// tenant does not yet exist. A mismatch returns *ConcurrencyError.
+	CompareAndSet(id string, tenantInfo resources.TenantInfo, expectedRevision string) error
+
+	// CompareAndDelete deletes id's tenant config only if its current
+	// revision equals expectedRevision. A mismatch — including the tenant
+	// already being gone, which a caller racing another delete cannot
+	// distinguish from a stale revision — returns *ConcurrencyError.
+	CompareAndDelete(id string, expectedRevision string) error
+
+	// CompareAndSetVersion updates the version config for id/version.Service
+	// only if its current revision equals expectedRevision, or, when
+	// expectedRevision is "", only if the version does not yet exist.
+	CompareAndSetVersion(id string, version resources.Version, expectedRevision string) error
+
+	// CompareAndDeleteVersion deletes the version config for id/service only
+	// if its current revision equals expectedRevision. As with
+	// CompareAndDelete, a version already gone is reported as a mismatch
+	// (*ConcurrencyError), not *RuleNotFoundError.
+	CompareAndDeleteVersion(id, service, expectedRevision string) error
+}
+
+// Entry is a tenant's stored configuration, as returned by Get.
+type Entry struct {
+	ProxyConfig resources.ProxyConfig
+	Revision    string
+}
+
+// NewManager creates a Manager backed by db.
+func NewManager(db Database) Manager {
+	return &manager{db: db}
+}
+
+// NewInMemoryManager creates a Manager backed by a fresh MemoryDatabase,
+// convenient for tests and single-replica deployments.
+func NewInMemoryManager() Manager {
+	return NewManager(NewMemoryDatabase())
+}
+
+// manager is the default Manager implementation. Its revisions are
+// monotonically increasing per-resource counters; a single mutex serializes
+// the read-modify-write each CompareAndSet/CompareAndDelete performs against
+// db, so concurrent callers race safely regardless of which backend db is.
+type manager struct {
+	db    Database
+	mutex sync.Mutex
+}
+
+// record is the envelope persisted for a tenant or version resource.
+type record struct {
+	Revision int64           `json:"revision"`
+	Value    json.RawMessage `json:"value"`
+}
+
+func tenantKey(id string) string           { return "tenant/" + id }
+func versionKey(id, service string) string { return "version/" + id + "/" + service }
+func revisionString(revision int64) string { return fmt.Sprintf("%d", revision) }
+
+func (m *manager) load(key string, out interface{}) (int64, bool, error) {
+	raw, ok, err := m.db.Get(key)
+	if err != nil {
+		return 0, false, &DBError{ErrorMessage: "db_read_error", Err: err}
+	}
+	if !ok {
+		return 0, false, nil
+	}
+
+	var rec record
+	if err := json.Unmarshal(raw, &rec); err != nil {
+		return 0, false, &DBError{ErrorMessage: "db_decode_error", Err: err}
+	}
+	if err := json.Unmarshal(rec.Value, out); err != nil {
+		return 0, false, &DBError{ErrorMessage: "db_decode_error", Err: err}
+	}
+	return rec.Revision, true, nil
+}
+
+func (m *manager) store(key string, revision int64, value interface{}) error {
+	encodedValue, err := json.Marshal(value)
+	if err != nil {
+		return &DBError{ErrorMessage: "db_encode_error", Err: err}
+	}
+	raw, err := json.Marshal(record{Revision: revision, Value: encodedValue})
+	if err != nil {
+		return &DBError{ErrorMessage: "db_encode_error", Err: err}
+	}
+	if err := m.db.Put(key, raw); err != nil {
+		return &DBError{ErrorMessage: "db_write_error", Err: err}
+	}
+	return nil
+}
+
+// checkPrecondition enforces the CompareAndSet/CompareAndSetVersion
+// precondition: expectedRevision == "" means "must not already exist",
+// anything else means "must match the current revision".
+func checkPrecondition(expectedRevision string, currentRevision int64, exists bool, alreadyExistsMsg, mismatchMsg string) error {
+	if expectedRevision == "" {
+		if exists {
+			return &ConcurrencyError{ErrorMessage: alreadyExistsMsg, Exists: true}
+		}
+		return nil
+	}
+	if !exists || revisionString(currentRevision) != expectedRevision {
+		return &ConcurrencyError{ErrorMessage: mismatchMsg}
+	}
+	return nil
+}
+
+func (m *manager) Create(id string, tenantInfo resources.TenantInfo) error {
+	return m.CompareAndSet(id, tenantInfo, "")
+}
+
+func (m *manager) Set(id string, tenantInfo resources.TenantInfo) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	key := tenantKey(id)
+	var existing resources.ProxyConfig
+	currentRevision, _, err := m.load(key, &existing)
+	if err != nil {
+		return err
+	}
+	return m.store(key, currentRevision+1, toProxyConfig(tenantInfo))
+}
+
+func (m *manager) CompareAndSet(id string, tenantInfo resources.TenantInfo, expectedRevision string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	key := tenantKey(id)
+	var existing resources.ProxyConfig
+	currentRevision, exists, err := m.load(key, &existing)
+	if err != nil {
+		return err
+	}
+	if err := checkPrecondition(expectedRevision, currentRevision, exists, "tenant_already_exists", "tenant_revision_mismatch"); err != nil {
+		return err
+	}
+
+	return m.store(key, currentRevision+1, toProxyConfig(tenantInfo))
+}
+
+func (m *manager) Get(id string) (*Entry, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var proxyConfig resources.ProxyConfig
+	revision, exists, err := m.load(tenantKey(id), &proxyConfig)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, &RuleNotFoundError{ErrorMessage: "tenant_not_found"}
+	}
+	return &Entry{ProxyConfig: proxyConfig, Revision: revisionString(revision)}, nil
+}
+
+func (m *manager) Delete(id string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.db.Delete(tenantKey(id))
+}
+
+func (m *manager) CompareAndDelete(id string, expectedRevision string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	key := tenantKey(id)
+	var existing resources.ProxyConfig
+	currentRevision, exists, err := m.load(key, &existing)
+	if err != nil {
+		return err
+	}
+	if !exists || revisionString(currentRevision) != expectedRevision {
+		return &ConcurrencyError{ErrorMessage: "tenant_revision_mismatch"}
+	}
+	return m.db.Delete(key)
+}
+
+func (m *manager) GetVersion(id, service string) (*resources.Version, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var version resources.Version
+	revision, exists, err := m.load(versionKey(id, service), &version)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, &RuleNotFoundError{ErrorMessage: "version_not_found"}
+	}
+	version.Service = service
+	version.Revision = revisionString(revision)
+	return &version, nil
+}
+
+func (m *manager) SetVersion(id string, version resources.Version) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	key := versionKey(id, version.Service)
+	var existing resources.Version
+	currentRevision, _, err := m.load(key, &existing)
+	if err != nil {
+		return err
+	}
+	return m.store(key, currentRevision+1, version)
+}
+
+func (m *manager) DeleteVersion(id, service string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.db.Delete(versionKey(id, service))
+}
+
+func (m *manager) CompareAndSetVersion(id string, version resources.Version, expectedRevision string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	key := versionKey(id, version.Service)
+	var existing resources.Version
+	currentRevision, exists, err := m.load(key, &existing)
+	if err != nil {
+		return err
+	}
+	if err := checkPrecondition(expectedRevision, currentRevision, exists, "version_already_exists", "version_revision_mismatch"); err != nil {
+		return err
+	}
+
+	return m.store(key, currentRevision+1, version)
+}
+
+func (m *manager) CompareAndDeleteVersion(id, service, expectedRevision string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	key := versionKey(id, service)
+	var existing resources.Version
+	currentRevision, exists, err := m.load(key, &existing)
+	if err != nil {
+		return err
+	}
+	if !exists || revisionString(currentRevision) != expectedRevision {
+		return &ConcurrencyError{ErrorMessage: "version_revision_mismatch"}
+	}
+	return m.db.Delete(key)
+}
+
+func toProxyConfig(tenantInfo resources.TenantInfo) resources.ProxyConfig {
+	return resources.ProxyConfig{
+		Credentials:       tenantInfo.Credentials,
+		LoadBalance:       tenantInfo.LoadBalance,
+		Port:              tenantInfo.Port,
+		ReqTrackingHeader: tenantInfo.ReqTrackingHeader,
+		Filters:           tenantInfo.Filters,
+	}
+}
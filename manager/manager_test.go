@@ -0,0 +1,178 @@
+// Copyright 2016 IBM Corporation
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package manager
+
+import (
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/amalgam8/controller/resources"
+	"github.com/stretchr/testify/assert"
+)
+
+// backends returns one Manager per Database implementation the series
+// supports, so the interleaved-write tests below run identically against
+// both the in-memory backend and a real (disk-backed) one.
+func backends(t *testing.T) map[string]Manager {
+	dir, err := ioutil.TempDir("", "manager-test")
+	assert.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	fileDB, err := NewFileDatabase(dir)
+	assert.NoError(t, err)
+
+	return map[string]Manager{
+		"memory": NewInMemoryManager(),
+		"file":   NewManager(fileDB),
+	}
+}
+
+func TestCompareAndSetCreateRaceExactlyOneWinner(t *testing.T) {
+	for name, m := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			var wg sync.WaitGroup
+			results := make([]error, 10)
+
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					results[i] = m.CompareAndSet("tenant1", resources.TenantInfo{ID: "tenant1"}, "")
+				}(i)
+			}
+			wg.Wait()
+
+			successes := 0
+			for _, err := range results {
+				if err == nil {
+					successes++
+					continue
+				}
+				concurrencyErr, ok := err.(*ConcurrencyError)
+				assert.True(t, ok, "unexpected error type: %v", err)
+				assert.True(t, concurrencyErr.Exists)
+			}
+			assert.Equal(t, 1, successes, "exactly one concurrent create should win")
+
+			entry, err := m.Get("tenant1")
+			assert.NoError(t, err)
+			assert.Equal(t, "1", entry.Revision)
+		})
+	}
+}
+
+func TestCompareAndSetUpdateRaceExactlyOneWinnerPerRevision(t *testing.T) {
+	for name, m := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			assert.NoError(t, m.Create("tenant1", resources.TenantInfo{ID: "tenant1"}))
+
+			entry, err := m.Get("tenant1")
+			assert.NoError(t, err)
+			staleRevision := entry.Revision
+
+			var wg sync.WaitGroup
+			results := make([]error, 10)
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					results[i] = m.CompareAndSet("tenant1", resources.TenantInfo{ID: "tenant1", Port: i}, staleRevision)
+				}(i)
+			}
+			wg.Wait()
+
+			successes := 0
+			for _, err := range results {
+				if err == nil {
+					successes++
+					continue
+				}
+				_, ok := err.(*ConcurrencyError)
+				assert.True(t, ok, "unexpected error type: %v", err)
+			}
+			assert.Equal(t, 1, successes, "only one writer racing against the same stale revision should win")
+
+			entry, err = m.Get("tenant1")
+			assert.NoError(t, err)
+			assert.Equal(t, "2", entry.Revision)
+		})
+	}
+}
+
+func TestCompareAndDeleteRaceExactlyOneWinner(t *testing.T) {
+	for name, m := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			assert.NoError(t, m.Create("tenant1", resources.TenantInfo{ID: "tenant1"}))
+			entry, err := m.Get("tenant1")
+			assert.NoError(t, err)
+
+			var wg sync.WaitGroup
+			results := make([]error, 10)
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					results[i] = m.CompareAndDelete("tenant1", entry.Revision)
+				}(i)
+			}
+			wg.Wait()
+
+			successes := 0
+			for _, err := range results {
+				if err == nil {
+					successes++
+					continue
+				}
+				_, ok := err.(*ConcurrencyError)
+				assert.True(t, ok, "unexpected error type: %v", err)
+			}
+			assert.Equal(t, 1, successes, "only one concurrent delete against the same revision should win")
+
+			_, err = m.Get("tenant1")
+			assert.IsType(t, &RuleNotFoundError{}, err)
+		})
+	}
+}
+
+func TestCompareAndSetVersionRaceExactlyOneWinner(t *testing.T) {
+	for name, m := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			var wg sync.WaitGroup
+			results := make([]error, 10)
+
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					results[i] = m.CompareAndSetVersion("tenant1", resources.Version{Service: "svcA"}, "")
+				}(i)
+			}
+			wg.Wait()
+
+			successes := 0
+			for _, err := range results {
+				if err == nil {
+					successes++
+					continue
+				}
+				_, ok := err.(*ConcurrencyError)
+				assert.True(t, ok, "unexpected error type: %v", err)
+			}
+			assert.Equal(t, 1, successes, "exactly one concurrent version create should win")
+		})
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2016 IBM Corporation
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package manager
+
+import "sync"
+
+// MemoryDatabase is a Database backed by an in-process map.
+type MemoryDatabase struct {
+	mutex sync.Mutex
+	data  map[string][]byte
+}
+
+// NewMemoryDatabase creates an empty MemoryDatabase.
+func NewMemoryDatabase() *MemoryDatabase {
+	return &MemoryDatabase{data: make(map[string][]byte)}
+}
+
+// Get implements Database.
+func (m *MemoryDatabase) Get(key string) ([]byte, bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	value, ok := m.data[key]
+	return value, ok, nil
+}
+
+// Put implements Database.
+func (m *MemoryDatabase) Put(key string, value []byte) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.data[key] = value
+	return nil
+}
+
+// Delete implements Database.
+func (m *MemoryDatabase) Delete(key string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.data, key)
+	return nil
+}
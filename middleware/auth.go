@@ -0,0 +1,272 @@
+// Copyright 2016 IBM Corporation
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package middleware
+
+import (
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// Claims carries the identity and authorization scope encoded in a tenant
+// access token. TenantID and Roles are Amalgam8-specific claims layered on
+// top of the standard registered claims.
+type Claims struct {
+	jwt.StandardClaims
+
+	// TenantID ("tid") identifies the tenant the token was issued for. It is
+	// empty for admin-scoped tokens, which are authorized by role alone.
+	TenantID string `json:"tid"`
+
+	// Roles lists the scopes granted to the token, e.g. "tenant.read",
+	// "tenant.write", "versions.write".
+	Roles []string `json:"roles"`
+}
+
+// HasRole reports whether the claims grant the given role.
+func (c *Claims) HasRole(role string) bool {
+	for _, r := range c.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// InvalidTokenError indicates that a bearer token could not be parsed or
+// verified (missing, malformed, expired, or signed with an unknown key).
+type InvalidTokenError struct {
+	ErrorMessage string
+}
+
+func (e *InvalidTokenError) Error() string {
+	return e.ErrorMessage
+}
+
+// ForbiddenError indicates that a token was valid but does not grant access
+// to the requested tenant or operation.
+type ForbiddenError struct {
+	ErrorMessage string
+}
+
+func (e *ForbiddenError) Error() string {
+	return e.ErrorMessage
+}
+
+// Authenticator verifies a bearer token and returns the claims it carries.
+// Tenant-scoped routes and admin-scoped routes (e.g. tenant bootstrap) are
+// expected to be backed by distinct Authenticator instances so that an
+// admin token's issuer/audience/signing key can differ from a tenant's.
+type Authenticator interface {
+	Authenticate(rawToken string) (*Claims, error)
+}
+
+// SigningMethod identifies how tokens handed to a JWTAuthenticator are signed.
+type SigningMethod string
+
+// Supported signing methods.
+const (
+	HS256 SigningMethod = "HS256"
+	RS256 SigningMethod = "RS256"
+)
+
+// JWTAuthenticatorConfig configures a JWTAuthenticator.
+type JWTAuthenticatorConfig struct {
+	// SigningMethod selects HS256 (HMACSecret) or RS256 (JWKSURL) verification.
+	SigningMethod SigningMethod
+
+	// HMACSecret is the shared secret used to verify HS256 tokens.
+	HMACSecret []byte
+
+	// JWKSURL is fetched (and cached for JWKSCacheTTL) to resolve RS256
+	// verification keys by "kid".
+	JWKSURL string
+
+	// JWKSCacheTTL controls how long fetched keys are reused before the JWKS
+	// endpoint is queried again. Defaults to 5 minutes.
+	JWKSCacheTTL time.Duration
+
+	// Issuer, if set, must match the token's "iss" claim.
+	Issuer string
+
+	// Audience, if set, must be present in the token's "aud" claim.
+	Audience string
+
+	// HTTPClient is used to fetch the JWKS document. Defaults to http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// JWTAuthenticator is the default Authenticator, verifying HS256 or RS256
+// bearer tokens and validating issuer/audience/expiry.
+type JWTAuthenticator struct {
+	conf JWTAuthenticatorConfig
+
+	mutex     sync.RWMutex
+	jwksAt    time.Time
+	jwksKeys  map[string]*rsa.PublicKey
+}
+
+// NewJWTAuthenticator creates a JWTAuthenticator from conf. It validates that
+// the configuration is internally consistent (e.g. an HMACSecret is present
+// for HS256) but does not perform any network I/O; JWKS documents are
+// fetched lazily on first use.
+func NewJWTAuthenticator(conf JWTAuthenticatorConfig) (*JWTAuthenticator, error) {
+	switch conf.SigningMethod {
+	case HS256:
+		if len(conf.HMACSecret) == 0 {
+			return nil, fmt.Errorf("middleware: HMACSecret is required for HS256")
+		}
+	case RS256:
+		if conf.JWKSURL == "" {
+			return nil, fmt.Errorf("middleware: JWKSURL is required for RS256")
+		}
+	default:
+		return nil, fmt.Errorf("middleware: unsupported signing method %q", conf.SigningMethod)
+	}
+
+	if conf.JWKSCacheTTL == 0 {
+		conf.JWKSCacheTTL = 5 * time.Minute
+	}
+	if conf.HTTPClient == nil {
+		conf.HTTPClient = http.DefaultClient
+	}
+
+	return &JWTAuthenticator{conf: conf}, nil
+}
+
+// Authenticate parses and verifies rawToken, returning its claims.
+func (a *JWTAuthenticator) Authenticate(rawToken string) (*Claims, error) {
+	if rawToken == "" {
+		return nil, &InvalidTokenError{ErrorMessage: "missing_token"}
+	}
+
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(rawToken, claims, a.keyFunc)
+	if err != nil {
+		if ve, ok := err.(*jwt.ValidationError); ok && ve.Errors&jwt.ValidationErrorExpired != 0 {
+			return nil, &InvalidTokenError{ErrorMessage: "token_expired"}
+		}
+		return nil, &InvalidTokenError{ErrorMessage: "token_invalid"}
+	}
+	if !token.Valid {
+		return nil, &InvalidTokenError{ErrorMessage: "token_invalid"}
+	}
+
+	if a.conf.Issuer != "" && claims.Issuer != a.conf.Issuer {
+		return nil, &InvalidTokenError{ErrorMessage: "issuer_mismatch"}
+	}
+	if a.conf.Audience != "" && !claims.VerifyAudience(a.conf.Audience, true) {
+		return nil, &InvalidTokenError{ErrorMessage: "audience_mismatch"}
+	}
+
+	return claims, nil
+}
+
+func (a *JWTAuthenticator) keyFunc(token *jwt.Token) (interface{}, error) {
+	switch a.conf.SigningMethod {
+	case HS256:
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+		return a.conf.HMACSecret, nil
+	case RS256:
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+		kid, _ := token.Header["kid"].(string)
+		return a.publicKey(kid)
+	default:
+		return nil, fmt.Errorf("unsupported signing method %q", a.conf.SigningMethod)
+	}
+}
+
+// jwks mirrors the subset of RFC 7517 fields this package understands.
+type jwks struct {
+	Keys []struct {
+		Kid string `json:"kid"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+	} `json:"keys"`
+}
+
+func (a *JWTAuthenticator) publicKey(kid string) (*rsa.PublicKey, error) {
+	a.mutex.RLock()
+	key, fresh := a.jwksKeys[kid], time.Since(a.jwksAt) < a.conf.JWKSCacheTTL
+	a.mutex.RUnlock()
+	if key != nil && fresh {
+		return key, nil
+	}
+
+	if err := a.refreshJWKS(); err != nil {
+		return nil, err
+	}
+
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	key = a.jwksKeys[kid]
+	if key == nil {
+		return nil, fmt.Errorf("middleware: no JWKS key for kid %q", kid)
+	}
+	return key, nil
+}
+
+func (a *JWTAuthenticator) refreshJWKS() error {
+	resp, err := a.conf.HTTPClient.Get(a.conf.JWKSURL)
+	if err != nil {
+		return fmt.Errorf("middleware: fetching JWKS: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("middleware: fetching JWKS: unexpected status %d", resp.StatusCode)
+	}
+
+	var doc jwks
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return fmt.Errorf("middleware: decoding JWKS: %v", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(doc.Keys))
+	for _, k := range doc.Keys {
+		pub, err := jwkToRSAPublicKey(k.N, k.E)
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+
+	a.mutex.Lock()
+	a.jwksKeys = keys
+	a.jwksAt = time.Now()
+	a.mutex.Unlock()
+	return nil
+}
+
+// ExtractBearerToken returns the raw token from an "Authorization: Bearer
+// <token>" header, or "" if the header is absent or malformed.
+func ExtractBearerToken(req *http.Request) string {
+	header := req.Header.Get("Authorization")
+	const prefix = "Bearer "
+	if !strings.HasPrefix(header, prefix) {
+		return ""
+	}
+	return strings.TrimPrefix(header, prefix)
+}
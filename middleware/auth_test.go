@@ -0,0 +1,139 @@
+// Copyright 2016 IBM Corporation
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package middleware
+
+import (
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+)
+
+const testSecret = "test-secret"
+
+func signToken(t *testing.T, claims *Claims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	signed, err := token.SignedString([]byte(testSecret))
+	assert.NoError(t, err)
+	return signed
+}
+
+func TestJWTAuthenticator(t *testing.T) {
+	authr, err := NewJWTAuthenticator(JWTAuthenticatorConfig{
+		SigningMethod: HS256,
+		HMACSecret:    []byte(testSecret),
+		Issuer:        "amalgam8-test",
+		Audience:      "amalgam8-controller",
+	})
+	assert.NoError(t, err)
+
+	validClaims := func() *Claims {
+		return &Claims{
+			StandardClaims: jwt.StandardClaims{
+				Issuer:    "amalgam8-test",
+				Audience:  "amalgam8-controller",
+				ExpiresAt: time.Now().Add(time.Hour).Unix(),
+			},
+			TenantID: "tenant1",
+			Roles:    []string{"tenant.read", "tenant.write"},
+		}
+	}
+
+	cases := []struct {
+		name        string
+		rawToken    func() string
+		wantErr     bool
+		wantTenant  string
+		wantRoles   []string
+	}{
+		{
+			name:       "valid token",
+			rawToken:   func() string { return signToken(t, validClaims()) },
+			wantErr:    false,
+			wantTenant: "tenant1",
+			wantRoles:  []string{"tenant.read", "tenant.write"},
+		},
+		{
+			name: "expired token",
+			rawToken: func() string {
+				claims := validClaims()
+				claims.ExpiresAt = time.Now().Add(-time.Hour).Unix()
+				return signToken(t, claims)
+			},
+			wantErr: true,
+		},
+		{
+			name: "wrong audience",
+			rawToken: func() string {
+				claims := validClaims()
+				claims.Audience = "someone-else"
+				return signToken(t, claims)
+			},
+			wantErr: true,
+		},
+		{
+			name: "wrong issuer",
+			rawToken: func() string {
+				claims := validClaims()
+				claims.Issuer = "someone-else"
+				return signToken(t, claims)
+			},
+			wantErr: true,
+		},
+		{
+			name:     "missing token",
+			rawToken: func() string { return "" },
+			wantErr:  true,
+		},
+		{
+			name:     "malformed token",
+			rawToken: func() string { return "not-a-jwt" },
+			wantErr:  true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			claims, err := authr.Authenticate(c.rawToken())
+			if c.wantErr {
+				assert.Error(t, err)
+				assert.IsType(t, &InvalidTokenError{}, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, c.wantTenant, claims.TenantID)
+			assert.Equal(t, c.wantRoles, claims.Roles)
+		})
+	}
+}
+
+func TestClaimsHasRole(t *testing.T) {
+	claims := &Claims{Roles: []string{"tenant.read", "versions.write"}}
+
+	cases := []struct {
+		role string
+		want bool
+	}{
+		{"tenant.read", true},
+		{"versions.write", true},
+		{"tenant.write", false},
+		{"", false},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.want, claims.HasRole(c.role), "role %q", c.role)
+	}
+}
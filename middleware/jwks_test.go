@@ -0,0 +1,114 @@
+// Copyright 2016 IBM Corporation
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func newJWKSServer(t *testing.T, kid string, key *rsa.PublicKey, requests *int) *httptest.Server {
+	doc := jwks{
+		Keys: []struct {
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		}{
+			{
+				Kid: kid,
+				N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			},
+		},
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests++
+		assert.NoError(t, json.NewEncoder(w).Encode(doc))
+	}))
+}
+
+func signRS256Token(t *testing.T, priv *rsa.PrivateKey, kid string, claims *Claims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(priv)
+	assert.NoError(t, err)
+	return signed
+}
+
+func TestJWTAuthenticatorRS256JWKS(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	const kid = "test-key-1"
+	var requests int
+	server := newJWKSServer(t, kid, &priv.PublicKey, &requests)
+	defer server.Close()
+
+	authr, err := NewJWTAuthenticator(JWTAuthenticatorConfig{
+		SigningMethod: RS256,
+		JWKSURL:       server.URL,
+		JWKSCacheTTL:  time.Minute,
+	})
+	assert.NoError(t, err)
+
+	rawToken := signRS256Token(t, priv, kid, &Claims{
+		StandardClaims: jwt.StandardClaims{ExpiresAt: time.Now().Add(time.Hour).Unix()},
+		TenantID:       "tenant1",
+		Roles:          []string{"tenant.read"},
+	})
+
+	claims, err := authr.Authenticate(rawToken)
+	assert.NoError(t, err)
+	assert.Equal(t, "tenant1", claims.TenantID)
+	assert.Equal(t, 1, requests, "JWKS document should be fetched once")
+
+	_, err = authr.Authenticate(rawToken)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, requests, "a second Authenticate within the cache TTL should not refetch the JWKS document")
+}
+
+func TestJWTAuthenticatorRS256UnknownKid(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	var requests int
+	server := newJWKSServer(t, "known-kid", &priv.PublicKey, &requests)
+	defer server.Close()
+
+	authr, err := NewJWTAuthenticator(JWTAuthenticatorConfig{
+		SigningMethod: RS256,
+		JWKSURL:       server.URL,
+	})
+	assert.NoError(t, err)
+
+	rawToken := signRS256Token(t, priv, "unknown-kid", &Claims{
+		StandardClaims: jwt.StandardClaims{ExpiresAt: time.Now().Add(time.Hour).Unix()},
+	})
+
+	_, err = authr.Authenticate(rawToken)
+	assert.Error(t, err)
+	assert.IsType(t, &InvalidTokenError{}, err)
+}
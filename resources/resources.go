@@ -0,0 +1,56 @@
+// Copyright 2016 IBM Corporation
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+// Package resources defines the JSON resources exchanged with Tenant API
+// clients and persisted by manager.Manager.
+package resources
+
+import "encoding/json"
+
+// TenantInfo is a tenant's credentials and proxy configuration, as exchanged
+// with API clients.
+type TenantInfo struct {
+	ID                string          `json:"id"`
+	Credentials       json.RawMessage `json:"credentials,omitempty"`
+	LoadBalance       string          `json:"load_balance,omitempty"`
+	Port              int             `json:"port,omitempty"`
+	ReqTrackingHeader string          `json:"req_tracking_header,omitempty"`
+	Filters           json.RawMessage `json:"filters,omitempty"`
+
+	// Revision is the tenant's current optimistic-concurrency token. The
+	// Controller sets it and echoes it back via the ETag response header;
+	// clients send it back via If-Match on PutTenant/DeleteTenant.
+	// If-None-Match is honored only as "*", on PutTenant.
+	Revision string `json:"revision,omitempty"`
+}
+
+// ProxyConfig is the subset of TenantInfo that manager.Manager persists and
+// hands to a tenant's sidecars.
+type ProxyConfig struct {
+	Credentials       json.RawMessage `json:"credentials,omitempty"`
+	LoadBalance       string          `json:"load_balance,omitempty"`
+	Port              int             `json:"port,omitempty"`
+	ReqTrackingHeader string          `json:"req_tracking_header,omitempty"`
+	Filters           json.RawMessage `json:"filters,omitempty"`
+}
+
+// Version is a service's version/routing configuration, as exchanged with
+// API clients.
+type Version struct {
+	Service string `json:"service"`
+
+	// Revision is the version's current optimistic-concurrency token; see
+	// TenantInfo.Revision.
+	Revision string `json:"revision,omitempty"`
+}